@@ -0,0 +1,119 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package system
+
+import (
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var _ Validator = &CgroupDriverValidator{}
+
+const procOnePidComm = "/proc/1/comm"
+
+// CgroupDriver describes the cgroup driver kubelet and the container runtime agree
+// to use to manage container cgroups.
+type CgroupDriver string
+
+const (
+	// CgroupDriverSystemd means cgroups are managed through systemd unit properties.
+	CgroupDriverSystemd CgroupDriver = "systemd"
+	// CgroupDriverCgroupfs means cgroups are managed by writing directly to cgroupfs.
+	CgroupDriverCgroupfs CgroupDriver = "cgroupfs"
+)
+
+// CgroupDriverValidator validates that kubelet and the container runtime will agree
+// on a cgroup driver, and — when running under systemd — that the unit invoking
+// kubelet has had the controllers it needs delegated to it. Containerd and CRI-O
+// both refuse to start on a v2 node whose invoking unit lacks the required
+// delegation, so catching it here surfaces the problem before kubelet does.
+type CgroupDriverValidator struct {
+	Reporter Reporter
+}
+
+// Name is part of the system.Validator interface.
+func (c *CgroupDriverValidator) Name() string {
+	return "cgroup-driver"
+}
+
+// Validate is part of the system.Validator interface.
+func (c *CgroupDriverValidator) Validate(spec SysSpec) (warns, errs []error) {
+	driver, err := c.detectDriver()
+	if err != nil {
+		return nil, []error{errors.Wrap(err, "failed to detect cgroup driver")}
+	}
+	c.Reporter.Report(cgroupsConfigPrefix+"DRIVER", string(driver), good)
+
+	var delegated []string
+	if driver == CgroupDriverSystemd {
+		delegated, err = c.detectDelegatedControllers()
+		if err != nil {
+			warns = append(warns, errors.Wrap(err, "failed to detect delegated cgroup controllers"))
+		} else {
+			c.Reporter.Report(cgroupsConfigPrefix+"DELEGATED", strings.Join(delegated, " "), good)
+		}
+	}
+
+	if spec.CgroupSpec.Driver != "" && spec.CgroupSpec.Driver != driver {
+		errs = append(errs, errors.Errorf("cgroup driver %q does not match required driver %q", driver, spec.CgroupSpec.Driver))
+	}
+	for _, controller := range spec.CgroupSpec.RequiredDelegated {
+		if !containsString(delegated, controller) {
+			errs = append(errs, errors.Errorf("controller %q is not delegated to this process's cgroup", controller))
+		}
+	}
+	return
+}
+
+// detectDriver reports whether PID 1 is systemd, which is the same test kubelet
+// and the container runtimes use to decide between the "systemd" and "cgroupfs"
+// cgroup drivers.
+func (c *CgroupDriverValidator) detectDriver() (CgroupDriver, error) {
+	content, err := os.ReadFile(procOnePidComm)
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(string(content)) == "systemd" {
+		return CgroupDriverSystemd, nil
+	}
+	return CgroupDriverCgroupfs, nil
+}
+
+// detectDelegatedControllers infers which controllers have been delegated to this
+// process's cgroup by reading the cgroup.controllers of its unified-hierarchy
+// cgroup: per systemd.resource-control(5), Delegate=/DelegateControllers= grant a
+// unit's own cgroup.controllers the listed controllers for it to manage, whereas
+// cgroup.subtree_control only reflects what that cgroup has itself since chosen to
+// pass down to grandchildren — which is still empty on a freshly delegated, healthy
+// node until kubelet writes to it. This avoids a D-Bus dependency at the cost of
+// only working under the unified (v2) hierarchy.
+func (c *CgroupDriverValidator) detectDelegatedControllers() ([]string, error) {
+	_, unifiedPath, err := parseSelfCgroup()
+	if err != nil {
+		return nil, err
+	}
+	if unifiedPath == "" {
+		return nil, errors.New("process has no unified cgroup path; delegation can only be inferred on cgroup v2")
+	}
+	content, err := os.ReadFile(cgroupRoot + unifiedPath + "/" + cgroupControllersFile)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(content)), nil
+}
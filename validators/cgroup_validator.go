@@ -18,6 +18,7 @@ package system
 
 import (
 	"bufio"
+	"io"
 	"os"
 	"strings"
 
@@ -38,51 +39,358 @@ func (c *CgroupsValidator) Name() string {
 
 const (
 	cgroupsConfigPrefix = "CGROUPS_"
+
+	procCgroups    = "/proc/cgroups"
+	procMountInfo  = "/proc/self/mountinfo"
+	procSelfCgroup = "/proc/self/cgroup"
+
+	cgroupRoot               = "/sys/fs/cgroup"
+	cgroupHybridUnifiedMount = cgroupRoot + "/unified"
+	cgroupControllersFile    = "cgroup.controllers"
+)
+
+// CgroupMode describes which cgroup hierarchy mode a host is booted with.
+type CgroupMode string
+
+const (
+	// CgroupModeUnified means the host exposes only the cgroup v2 unified hierarchy.
+	CgroupModeUnified CgroupMode = "unified"
+	// CgroupModeLegacy means the host exposes only the cgroup v1 per-controller hierarchies.
+	CgroupModeLegacy CgroupMode = "legacy"
+	// CgroupModeHybrid means the host exposes the v1 hierarchies alongside a v2
+	// hierarchy mounted at /sys/fs/cgroup/unified.
+	CgroupModeHybrid CgroupMode = "hybrid"
 )
 
 // Validate is part of the system.Validator interface.
 func (c *CgroupsValidator) Validate(spec SysSpec) (warns, errs []error) {
-	subsystems, err := c.getCgroupSubsystems()
+	mode, err := detectCgroupMode()
+	if err != nil {
+		return nil, []error{errors.Wrap(err, "failed to detect cgroup hierarchy mode")}
+	}
+	c.Reporter.Report(cgroupsConfigPrefix+"MODE", string(mode), good)
+	if spec.CgroupSpec.Mode != "" && spec.CgroupSpec.Mode != mode {
+		errs = append(errs, errors.Errorf("cgroup hierarchy mode %q does not match required mode %q", mode, spec.CgroupSpec.Mode))
+	}
+
+	subsystems, err := getCgroupSubsystems(mode)
 	if err != nil {
 		return nil, []error{errors.Wrap(err, "failed to get cgroup subsystems")}
 	}
-	if missingRequired := c.validateCgroupSubsystems(spec.CgroupSpec.Required, subsystems, true); len(missingRequired) != 0 {
-		errs = []error{errors.Errorf("missing required cgroups: %s", strings.Join(missingRequired, " "))}
+	missingRequired, writabilityErrs := c.validateCgroupSubsystems(mode, spec.CgroupSpec.Required, subsystems, true)
+	if len(missingRequired) != 0 {
+		errs = append(errs, errors.Errorf("missing required cgroups: %s", strings.Join(missingRequired, " ")))
 	}
-	if missingOptional := c.validateCgroupSubsystems(spec.CgroupSpec.Optional, subsystems, false); len(missingOptional) != 0 {
-		warns = []error{errors.Errorf("missing optional cgroups: %s", strings.Join(missingOptional, " "))}
+	errs = append(errs, writabilityErrs...)
+	if missingOptional, _ := c.validateCgroupSubsystems(mode, spec.CgroupSpec.Optional, subsystems, false); len(missingOptional) != 0 {
+		warns = append(warns, errors.Errorf("missing optional cgroups: %s", strings.Join(missingOptional, " ")))
+	}
+
+	if membershipErrs := c.validateCgroupMembership(mode, spec.CgroupSpec.Required, subsystems); len(membershipErrs) != 0 {
+		errs = append(errs, membershipErrs...)
 	}
 	return
 }
 
-// validateCgroupSubsystems returns a list with the missing cgroups in the cgroup
-func (c *CgroupsValidator) validateCgroupSubsystems(cgroups, subsystems []string, required bool) []string {
+// validateCgroupMembership reports the cgroup path this process is attached to for
+// every controller named in /proc/self/cgroup, and fails validation if a required,
+// host-enabled controller has this process attached to its root cgroup "/" — a
+// common misconfiguration inside unprivileged containers where the controller is
+// compiled in but not delegated, so kubelet cannot create sub-cgroups under it. On
+// unified hosts the single unified cgroup path is checked for every controller; on
+// hybrid hosts a controller's legacy path is checked where it has one, and the
+// unified path otherwise.
+func (c *CgroupsValidator) validateCgroupMembership(mode CgroupMode, required, subsystems []string) []error {
+	controllerPaths, unifiedPath, err := parseSelfCgroup()
+	if err != nil {
+		return []error{errors.Wrap(err, "failed to parse /proc/self/cgroup")}
+	}
+
+	for controller, path := range controllerPaths {
+		c.Reporter.Report(cgroupsConfigPrefix+strings.ToUpper(controller)+"_PATH", path, good)
+	}
+	if unifiedPath != "" {
+		c.Reporter.Report(cgroupsConfigPrefix+"UNIFIED_PATH", unifiedPath, good)
+	}
+
+	var errs []error
+	for _, controller := range required {
+		if !containsString(subsystems, controller) {
+			continue
+		}
+		atRoot := false
+		switch mode {
+		case CgroupModeUnified:
+			atRoot = unifiedPath == "/"
+		case CgroupModeHybrid:
+			if path, ok := controllerPaths[controller]; ok {
+				atRoot = path == "/"
+			} else {
+				atRoot = unifiedPath == "/"
+			}
+		default:
+			atRoot = controllerPaths[controller] == "/"
+		}
+		if atRoot {
+			errs = append(errs, errors.Errorf(
+				"cgroup controller %q is enabled on this host but this process is attached to its root cgroup; "+
+					"the controller must be delegated a sub-cgroup", controller))
+		}
+	}
+	return errs
+}
+
+// parseSelfCgroup parses /proc/self/cgroup, returning the cgroup path this process
+// is attached to for each legacy (v1) controller, plus its unified (v2) path if any.
+// Lines are either "hierarchyID:controllerList:path" (v1, with comma-separated
+// controllers) or "0::path" (v2, empty controller list). See cgroups(7).
+func parseSelfCgroup() (controllerPaths map[string]string, unifiedPath string, err error) {
+	f, err := os.Open(procSelfCgroup)
+	if err != nil {
+		return nil, "", err
+	}
+	defer f.Close()
+	return parseSelfCgroupReader(f)
+}
+
+// parseSelfCgroupReader is the testable core of parseSelfCgroup, reading from an
+// arbitrary io.Reader instead of the live /proc/self/cgroup.
+func parseSelfCgroupReader(r io.Reader) (controllerPaths map[string]string, unifiedPath string, err error) {
+	controllerPaths = map[string]string{}
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		if err := s.Err(); err != nil {
+			return nil, "", err
+		}
+		fields := strings.SplitN(s.Text(), ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		controllers, path := fields[1], fields[2]
+		if controllers == "" {
+			unifiedPath = path
+			continue
+		}
+		for _, controller := range strings.Split(controllers, ",") {
+			controllerPaths[controller] = path
+		}
+	}
+	return controllerPaths, unifiedPath, nil
+}
+
+// containsString reports whether s contains v.
+func containsString(s []string, v string) bool {
+	for _, item := range s {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
+
+// validateCgroupSubsystems returns the list of cgroups missing from subsystems. For
+// required controllers that are present, it additionally probes that the controller's
+// mount point is actually writable — a controller can show up as enabled in
+// /proc/cgroups or cgroup.controllers yet be unmounted or mounted read-only, which
+// otherwise only surfaces as a runtime error when the container runtime first tries
+// to create a cgroup under it — and returns any such writability failures as errors.
+func (c *CgroupsValidator) validateCgroupSubsystems(mode CgroupMode, cgroups, subsystems []string, required bool) ([]string, []error) {
 	var missing []string
+	var errs []error
 	for _, cgroup := range cgroups {
-		found := false
-		for _, subsystem := range subsystems {
-			if cgroup == subsystem {
-				found = true
-				break
+		found := containsString(subsystems, cgroup)
+		item := cgroupsConfigPrefix + strings.ToUpper(cgroup)
+		if !found {
+			if required {
+				c.Reporter.Report(item, "missing", bad)
+			} else {
+				c.Reporter.Report(item, "missing", warn)
 			}
+			missing = append(missing, cgroup)
+			continue
 		}
-		item := cgroupsConfigPrefix + strings.ToUpper(cgroup)
-		if found {
+		if !required {
 			c.Reporter.Report(item, "enabled", good)
 			continue
-		} else if required {
-			c.Reporter.Report(item, "missing", bad)
-		} else {
-			c.Reporter.Report(item, "missing", warn)
 		}
-		missing = append(missing, cgroup)
+
+		status, err := c.probeControllerWritable(mode, cgroup)
+		switch {
+		case err != nil:
+			c.Reporter.Report(item, "unmounted", bad)
+			errs = append(errs, errors.Wrapf(err, "required cgroup controller %q", cgroup))
+		case status == cgroupWritable:
+			c.Reporter.Report(item, "writable", good)
+		case status == cgroupReadonly:
+			c.Reporter.Report(item, "readonly", bad)
+			errs = append(errs, errors.Errorf("required cgroup controller %q is mounted read-only", cgroup))
+		}
 	}
-	return missing
+	return missing, errs
+}
+
+// cgroupWritability describes whether a cgroup controller's mount point could be
+// probed for write access.
+type cgroupWritability int
 
+const (
+	cgroupWritable cgroupWritability = iota
+	cgroupReadonly
+)
+
+// probeControllerWritable locates the mount point backing controller and attempts to
+// create and remove a temporary directory in it, the same operation the container
+// runtime performs to create a sub-cgroup.
+func (c *CgroupsValidator) probeControllerWritable(mode CgroupMode, controller string) (cgroupWritability, error) {
+	mountPoint, err := c.controllerMountPoint(mode, controller)
+	if err != nil {
+		return cgroupReadonly, err
+	}
+	dir, err := os.MkdirTemp(mountPoint, ".cgroup-validator-probe-")
+	if err != nil {
+		return cgroupReadonly, nil
+	}
+	if err := os.Remove(dir); err != nil {
+		return cgroupWritable, errors.Wrapf(err, "failed to clean up cgroup writability probe directory %q", dir)
+	}
+	return cgroupWritable, nil
 }
 
-func (c *CgroupsValidator) getCgroupSubsystems() ([]string, error) {
-	f, err := os.Open("/proc/cgroups")
+// controllerMountPoint returns the mount point backing controller for the given
+// cgroup hierarchy mode. For the unified hierarchy this is this process's own
+// delegated cgroup directory, not the bare hierarchy root: a systemd-delegated unit
+// is typically only granted write access to its own cgroup.controllers subtree, so
+// probing the root itself would either misreport a healthy, correctly-delegated node
+// as read-only, or — running as root — create a stray cgroup in the wrong place.
+func (c *CgroupsValidator) controllerMountPoint(mode CgroupMode, controller string) (string, error) {
+	switch mode {
+	case CgroupModeUnified:
+		return c.unifiedControllerMountPoint(cgroupRoot)
+	case CgroupModeHybrid:
+		if mountPoint, err := findLegacyControllerMount(controller); err == nil {
+			return mountPoint, nil
+		}
+		controllers, err := getUnifiedCgroupControllers(cgroupHybridUnifiedMount)
+		if err != nil {
+			return "", err
+		}
+		if containsString(controllers, controller) {
+			return c.unifiedControllerMountPoint(cgroupHybridUnifiedMount)
+		}
+		return "", errors.Errorf("no mount found for controller %q", controller)
+	default:
+		return findLegacyControllerMount(controller)
+	}
+}
+
+// unifiedControllerMountPoint returns this process's own cgroup directory under the
+// unified hierarchy mounted at root, i.e. the actual path write access is delegated
+// to, by resolving /proc/self/cgroup's unified path against root.
+func (c *CgroupsValidator) unifiedControllerMountPoint(root string) (string, error) {
+	_, unifiedPath, err := parseSelfCgroup()
+	if err != nil {
+		return "", err
+	}
+	if unifiedPath == "" {
+		return "", errors.New("process has no unified cgroup path")
+	}
+	return root + unifiedPath, nil
+}
+
+// detectCgroupMode determines whether the host is running the legacy per-controller
+// cgroup v1 hierarchy, the unified cgroup v2 hierarchy, or a hybrid of the two, by
+// inspecting the mounts under /sys/fs/cgroup recorded in /proc/self/mountinfo.
+func detectCgroupMode() (CgroupMode, error) {
+	f, err := os.Open(procMountInfo)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return detectCgroupModeFromMountInfo(f)
+}
+
+// detectCgroupModeFromMountInfo is the testable core of detectCgroupMode, reading
+// from an arbitrary io.Reader instead of the live /proc/self/mountinfo.
+func detectCgroupModeFromMountInfo(r io.Reader) (CgroupMode, error) {
+	var sawUnifiedRoot, sawHybridUnified, sawLegacy bool
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		if err := s.Err(); err != nil {
+			return "", err
+		}
+		mountPoint, fsType, _, ok := parseMountInfoLine(s.Text())
+		if !ok {
+			continue
+		}
+		switch {
+		case mountPoint == cgroupRoot && fsType == "cgroup2":
+			sawUnifiedRoot = true
+		case mountPoint == cgroupHybridUnifiedMount && fsType == "cgroup2":
+			sawHybridUnified = true
+		case fsType == "cgroup":
+			sawLegacy = true
+		}
+	}
+
+	switch {
+	case sawUnifiedRoot:
+		return CgroupModeUnified, nil
+	case sawHybridUnified && sawLegacy:
+		return CgroupModeHybrid, nil
+	case sawLegacy:
+		return CgroupModeLegacy, nil
+	}
+	return "", errors.New("unable to find a cgroup v1 or v2 mount under " + cgroupRoot)
+}
+
+// parseMountInfoLine parses a single line of /proc/[pid]/mountinfo, returning the
+// mount point, filesystem type and the filesystem-specific super options (e.g. the
+// controller names listed against a legacy per-controller cgroup mount). See proc(5)
+// for the format.
+func parseMountInfoLine(line string) (mountPoint, fsType string, superOptions []string, ok bool) {
+	parts := strings.SplitN(line, " - ", 2)
+	if len(parts) != 2 {
+		return "", "", nil, false
+	}
+	left := strings.Fields(parts[0])
+	right := strings.Fields(parts[1])
+	if len(left) < 5 || len(right) < 3 {
+		return "", "", nil, false
+	}
+	return left[4], right[0], strings.Split(right[2], ","), true
+}
+
+func getCgroupSubsystems(mode CgroupMode) ([]string, error) {
+	switch mode {
+	case CgroupModeUnified:
+		return getUnifiedCgroupControllers(cgroupRoot)
+	case CgroupModeHybrid:
+		legacy, err := getLegacyCgroupSubsystems()
+		if err != nil {
+			return nil, err
+		}
+		unified, err := getUnifiedCgroupControllers(cgroupHybridUnifiedMount)
+		if err != nil {
+			return nil, err
+		}
+		return unionStrings(legacy, unified), nil
+	default:
+		return getLegacyCgroupSubsystems()
+	}
+}
+
+// getUnifiedCgroupControllers reads the space-separated list of enabled controllers
+// advertised by the unified hierarchy mounted at mountPoint.
+func getUnifiedCgroupControllers(mountPoint string) ([]string, error) {
+	content, err := os.ReadFile(mountPoint + "/" + cgroupControllersFile)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(content)), nil
+}
+
+func getLegacyCgroupSubsystems() ([]string, error) {
+	f, err := os.Open(procCgroups)
 	if err != nil {
 		return nil, err
 	}
@@ -104,3 +412,44 @@ func (c *CgroupsValidator) getCgroupSubsystems() ([]string, error) {
 	}
 	return subsystems, nil
 }
+
+// findLegacyControllerMount returns the mount point of the legacy (v1) cgroup
+// hierarchy that has the given controller among its super options, e.g. "memory".
+func findLegacyControllerMount(controller string) (string, error) {
+	f, err := os.Open(procMountInfo)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		if err := s.Err(); err != nil {
+			return "", err
+		}
+		mountPoint, fsType, superOptions, ok := parseMountInfoLine(s.Text())
+		if !ok || fsType != "cgroup" {
+			continue
+		}
+		for _, opt := range superOptions {
+			if opt == controller {
+				return mountPoint, nil
+			}
+		}
+	}
+	return "", errors.Errorf("no legacy cgroup mount found for controller %q", controller)
+}
+
+// unionStrings returns the set union of a and b, preserving the order in which
+// elements are first seen.
+func unionStrings(a, b []string) []string {
+	seen := make(map[string]bool, len(a)+len(b))
+	union := make([]string, 0, len(a)+len(b))
+	for _, s := range append(append([]string{}, a...), b...) {
+		if !seen[s] {
+			seen[s] = true
+			union = append(union, s)
+		}
+	}
+	return union
+}
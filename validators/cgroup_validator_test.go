@@ -0,0 +1,178 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package system
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const legacyMountInfo = `22 28 0:21 / /sys/fs/cgroup ro,nosuid,nodev,noexec shared:9 - tmpfs tmpfs ro,mode=755
+23 22 0:22 / /sys/fs/cgroup/systemd rw,nosuid,nodev,noexec shared:10 - cgroup cgroup rw,xattr,name=systemd
+24 22 0:23 / /sys/fs/cgroup/memory rw,nosuid,nodev,noexec shared:11 - cgroup cgroup rw,memory
+25 22 0:24 / /sys/fs/cgroup/cpu,cpuacct rw,nosuid,nodev,noexec shared:12 - cgroup cgroup rw,cpu,cpuacct
+`
+
+const unifiedMountInfo = `22 28 0:21 / /sys/fs/cgroup rw,nosuid,nodev,noexec,relatime shared:9 - cgroup2 cgroup2 rw
+`
+
+const hybridMountInfo = `22 28 0:21 / /sys/fs/cgroup ro,nosuid,nodev,noexec shared:9 - tmpfs tmpfs ro,mode=755
+23 22 0:22 / /sys/fs/cgroup/memory rw,nosuid,nodev,noexec shared:10 - cgroup cgroup rw,memory
+24 22 0:23 / /sys/fs/cgroup/unified rw,nosuid,nodev,noexec shared:11 - cgroup2 cgroup2 rw
+`
+
+func TestParseMountInfoLine(t *testing.T) {
+	tests := []struct {
+		name             string
+		line             string
+		wantMountPoint   string
+		wantFSType       string
+		wantSuperOptions []string
+		wantOK           bool
+	}{
+		{
+			name:             "legacy memory controller mount",
+			line:             "24 22 0:23 / /sys/fs/cgroup/memory rw,nosuid,nodev,noexec shared:11 - cgroup cgroup rw,memory",
+			wantMountPoint:   "/sys/fs/cgroup/memory",
+			wantFSType:       "cgroup",
+			wantSuperOptions: []string{"rw", "memory"},
+			wantOK:           true,
+		},
+		{
+			name:             "unified mount",
+			line:             "22 28 0:21 / /sys/fs/cgroup rw,nosuid,nodev,noexec,relatime shared:9 - cgroup2 cgroup2 rw",
+			wantMountPoint:   "/sys/fs/cgroup",
+			wantFSType:       "cgroup2",
+			wantSuperOptions: []string{"rw"},
+			wantOK:           true,
+		},
+		{
+			name:   "missing separator",
+			line:   "22 28 0:21 / /sys/fs/cgroup rw,nosuid,nodev,noexec,relatime shared:9",
+			wantOK: false,
+		},
+		{
+			name:   "too few fields before separator",
+			line:   "22 28 0:21 - cgroup2 cgroup2 rw",
+			wantOK: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mountPoint, fsType, superOptions, ok := parseMountInfoLine(tt.line)
+			if ok != tt.wantOK {
+				t.Fatalf("ok = %v, want %v", ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if mountPoint != tt.wantMountPoint {
+				t.Errorf("mountPoint = %q, want %q", mountPoint, tt.wantMountPoint)
+			}
+			if fsType != tt.wantFSType {
+				t.Errorf("fsType = %q, want %q", fsType, tt.wantFSType)
+			}
+			if !reflect.DeepEqual(superOptions, tt.wantSuperOptions) {
+				t.Errorf("superOptions = %v, want %v", superOptions, tt.wantSuperOptions)
+			}
+		})
+	}
+}
+
+func TestDetectCgroupModeFromMountInfo(t *testing.T) {
+	tests := []struct {
+		name      string
+		mountInfo string
+		want      CgroupMode
+		wantErr   bool
+	}{
+		{name: "legacy", mountInfo: legacyMountInfo, want: CgroupModeLegacy},
+		{name: "unified", mountInfo: unifiedMountInfo, want: CgroupModeUnified},
+		{name: "hybrid", mountInfo: hybridMountInfo, want: CgroupModeHybrid},
+		{name: "no cgroup mounts", mountInfo: "22 28 0:21 / / rw - ext4 /dev/sda1 rw\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := detectCgroupModeFromMountInfo(strings.NewReader(tt.mountInfo))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got mode %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("mode = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSelfCgroupReader(t *testing.T) {
+	tests := []struct {
+		name               string
+		content            string
+		wantControllerPath map[string]string
+		wantUnifiedPath    string
+	}{
+		{
+			name:               "cgroup v2 only",
+			content:            "0::/kubepods.slice/kubepods-besteffort.slice\n",
+			wantControllerPath: map[string]string{},
+			wantUnifiedPath:    "/kubepods.slice/kubepods-besteffort.slice",
+		},
+		{
+			name: "cgroup v1 with multiple controllers per line",
+			content: "11:memory:/kubepods/burstable\n" +
+				"4:cpu,cpuacct:/kubepods/burstable\n" +
+				"1:name=systemd:/\n",
+			wantControllerPath: map[string]string{
+				"memory":       "/kubepods/burstable",
+				"cpu":          "/kubepods/burstable",
+				"cpuacct":      "/kubepods/burstable",
+				"name=systemd": "/",
+			},
+			wantUnifiedPath: "",
+		},
+		{
+			name:               "malformed line is ignored",
+			content:            "not-a-valid-line\n11:memory:/\n",
+			wantControllerPath: map[string]string{"memory": "/"},
+			wantUnifiedPath:    "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			controllerPaths, unifiedPath, err := parseSelfCgroupReader(strings.NewReader(tt.content))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(controllerPaths, tt.wantControllerPath) {
+				t.Errorf("controllerPaths = %v, want %v", controllerPaths, tt.wantControllerPath)
+			}
+			if unifiedPath != tt.wantUnifiedPath {
+				t.Errorf("unifiedPath = %q, want %q", unifiedPath, tt.wantUnifiedPath)
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package system
+
+// Reporter is the interface that all validators use to report the result of
+// a single validation item.
+type Reporter interface {
+	Report(name, msg string, result ValidationResultType) error
+}
+
+// ValidationResultType marks the result of a single validation item.
+type ValidationResultType int
+
+const (
+	good ValidationResultType = iota
+	bad
+	warn
+)
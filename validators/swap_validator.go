@@ -0,0 +1,168 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package system
+
+import (
+	"bufio"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+var _ Validator = &SwapValidator{}
+
+const (
+	procSwaps = "/proc/swaps"
+
+	memswLimitFile = "memory.memsw.limit_in_bytes"
+	memSwapMaxFile = "memory.swap.max"
+)
+
+// SwapValidator validates that the memory controller's swap accounting support
+// matches whether swap itself is enabled on the host. Kubelet and containerd both
+// require the memory controller to expose swap-limit accounting whenever swap is
+// turned on; when it doesn't, they fail late with an "unable to find memsw" style
+// runtime error instead of at startup.
+type SwapValidator struct {
+	Reporter Reporter
+}
+
+// Name is part of the system.Validator interface.
+func (s *SwapValidator) Name() string {
+	return "swap"
+}
+
+// Validate is part of the system.Validator interface.
+func (s *SwapValidator) Validate(spec SysSpec) (warns, errs []error) {
+	swapOn, err := s.isSwapEnabled()
+	if err != nil {
+		return nil, []error{errors.Wrap(err, "failed to read /proc/swaps")}
+	}
+
+	status, err := s.detectSwapAccountingStatus()
+	if err != nil {
+		return nil, []error{errors.Wrap(err, "failed to determine memory controller swap accounting support")}
+	}
+
+	switch status {
+	case swapAccountingEnabled:
+		s.Reporter.Report(cgroupsConfigPrefix+"MEMORY_SWAP", "enabled", good)
+	case swapAccountingNoMemoryController:
+		s.Reporter.Report(cgroupsConfigPrefix+"MEMORY_SWAP", "missing", warn)
+		if swapOn {
+			errs = append(errs, errors.New("swap is enabled but the memory cgroup controller is not present on this host; "+
+				"enable the memory controller (e.g. CONFIG_MEMCG, or cgroup_enable=memory on the kernel command line)"))
+		}
+	case swapAccountingUnsupported:
+		s.Reporter.Report(cgroupsConfigPrefix+"MEMORY_SWAP", "missing", warn)
+		if swapOn {
+			errs = append(errs, errors.New("swap is enabled but the memory controller does not support swap accounting "+
+				"(neither memory.memsw.limit_in_bytes nor memory.swap.max is available); "+
+				"either disable swap or boot with swap accounting enabled"))
+		}
+	}
+	return
+}
+
+// isSwapEnabled reports whether the host has any swap device or file active, by
+// reading /proc/swaps: the file always has a header line, followed by one line per
+// active swap area.
+func (s *SwapValidator) isSwapEnabled() (bool, error) {
+	f, err := os.Open(procSwaps)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	lines := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return false, err
+		}
+		lines++
+	}
+	return lines > 1, nil
+}
+
+// swapAccountingStatus distinguishes the reasons swap-limit accounting support can
+// be unavailable, so Validate can point the operator at the right remediation:
+// an absent memory controller needs a kernel/boot config change, while a present
+// controller missing the swap-limit file just needs swap or accounting toggled.
+type swapAccountingStatus int
+
+const (
+	swapAccountingEnabled swapAccountingStatus = iota
+	swapAccountingUnsupported
+	swapAccountingNoMemoryController
+)
+
+// detectSwapAccountingStatus reports whether the memory controller exposes swap-limit
+// accounting: memory.memsw.limit_in_bytes under the legacy (v1) memory controller
+// mount, or memory.swap.max in this process's own cgroup under the unified (v2)
+// hierarchy — and whether the memory controller is even present at all.
+func (s *SwapValidator) detectSwapAccountingStatus() (swapAccountingStatus, error) {
+	mode, err := detectCgroupMode()
+	if err != nil {
+		return 0, err
+	}
+
+	subsystems, err := getCgroupSubsystems(mode)
+	if err != nil {
+		return 0, err
+	}
+	if !containsString(subsystems, "memory") {
+		return swapAccountingNoMemoryController, nil
+	}
+
+	var swapFileExists bool
+	switch mode {
+	case CgroupModeUnified:
+		// memory.swap.max only exists on non-root cgroups, so it is looked up in
+		// this process's own cgroup rather than at the hierarchy root.
+		_, unifiedPath, err := parseSelfCgroup()
+		if err != nil {
+			return 0, err
+		}
+		swapFileExists = fileExists(cgroupRoot + unifiedPath + "/" + memSwapMaxFile)
+	case CgroupModeHybrid:
+		// The memory controller on a hybrid host almost always still lives on the
+		// legacy hierarchy, with nothing delegated to the v2 unified mount; check
+		// there first, the same legacy-first union getCgroupSubsystems uses.
+		if memoryMount, err := findLegacyControllerMount("memory"); err == nil {
+			swapFileExists = fileExists(memoryMount + "/" + memswLimitFile)
+		} else if _, unifiedPath, err := parseSelfCgroup(); err == nil {
+			swapFileExists = fileExists(cgroupHybridUnifiedMount + unifiedPath + "/" + memSwapMaxFile)
+		}
+	default:
+		memoryMount, err := findLegacyControllerMount("memory")
+		if err != nil {
+			return 0, err
+		}
+		swapFileExists = fileExists(memoryMount + "/" + memswLimitFile)
+	}
+
+	if swapFileExists {
+		return swapAccountingEnabled, nil
+	}
+	return swapAccountingUnsupported, nil
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,50 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package system
+
+// SysSpec defines the requirement of expected system spec.
+type SysSpec struct {
+	// CgroupSpec defines the cgroup controllers that must/should be enabled.
+	CgroupSpec CgroupSpec `json:"cgroupsValidation"`
+}
+
+// CgroupSpec defines the configuration requirements of the cgroup subsystem.
+type CgroupSpec struct {
+	// Required is the list of cgroup controllers that must be enabled.
+	Required []string `json:"required,omitempty"`
+	// Optional is the list of cgroup controllers that should be enabled but
+	// whose absence is only a warning.
+	Optional []string `json:"optional,omitempty"`
+	// Mode, if set, requires the host to boot with a specific cgroup hierarchy
+	// mode (one of "unified", "legacy" or "hybrid").
+	Mode CgroupMode `json:"mode,omitempty"`
+	// Driver, if set, requires kubelet's invoking process to be running under a
+	// specific cgroup driver ("systemd" or "cgroupfs").
+	Driver CgroupDriver `json:"driver,omitempty"`
+	// RequiredDelegated lists the controllers that must be delegated to this
+	// process's cgroup when running under the systemd driver.
+	RequiredDelegated []string `json:"requiredDelegated,omitempty"`
+}
+
+// Validator is the interface for all validators.
+type Validator interface {
+	// Name is the name of the validator.
+	Name() string
+	// Validate validates a system configuration against the given spec and
+	// returns the warnings and errors it found, if any.
+	Validate(spec SysSpec) (warns, errs []error)
+}